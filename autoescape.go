@@ -0,0 +1,99 @@
+package quicktemplate
+
+import (
+	"strings"
+)
+
+// AttrSafe escapes s for use as the value of a quoted or unquoted HTML
+// attribute and writes it to qw. It is stricter than S: in addition to
+// the standard HTML entities it also escapes quotes, backticks and
+// whitespace so the value can't break out of an attribute regardless of
+// how it's quoted.
+//
+// It's selected automatically for {%s %} tags inside {% autoescape html %}
+// blocks when the surrounding text places the tag inside an attribute
+// value. Unlike E().S, it's a plain *QWriter method - not chained off
+// E() - since qtc emits it as "qw.AttrSafe(...)" directly.
+func (qw *QWriter) AttrSafe(s string) {
+	qw.E().S(attrSafeReplacer.Replace(s))
+}
+
+// URLSafe writes s to qw for use as the value of a URL-bearing HTML
+// attribute such as href, src or action.
+//
+// The check below runs against the actual runtime value of s, not
+// against the source text of the expression that produced it, so it
+// also catches an attacker-controlled variable holding a "javascript:"
+// or other dangerous-scheme URL, not just an inline string literal
+// spelled that way in the template.
+func (qw *QWriter) URLSafe(s string) {
+	if scheme, ok := urlScheme(s); ok && !safeURLSchemes[scheme] {
+		s = "#" + zapURLPlaceholder
+	}
+	qw.E().S(attrSafeReplacer.Replace(s))
+}
+
+// JSSafe escapes s for safe interpolation into a <script> block by
+// reusing the JSON string escaper already used for the {%j %} filter -
+// a JSON-encoded string is always a valid, self-contained JS string
+// literal.
+func (qw *QWriter) JSSafe(s string) {
+	qw.E().J(s)
+}
+
+// CSSSafe escapes s for safe interpolation into a <style> block.
+//
+// It's selected automatically for {%s %} tags inside {% autoescape html %}
+// blocks when the surrounding text places the tag inside a <style>
+// element.
+func (qw *QWriter) CSSSafe(s string) {
+	qw.E().S(cssSafeReplacer.Replace(s))
+}
+
+// zapURLPlaceholder replaces a URL with an unsafe scheme, mirroring the
+// "#ZgotmplZ" convention html/template uses for the same purpose: a
+// value that's obviously broken rather than one that silently executes.
+const zapURLPlaceholder = "ZqtplZ"
+
+// safeURLSchemes lists the URL schemes autoescape permits into
+// href/src/action attributes. Anything else - most importantly
+// "javascript:" and "data:" - is defanged instead.
+var safeURLSchemes = map[string]bool{
+	"http": true, "https": true, "mailto": true, "tel": true, "ftp": true,
+}
+
+// urlScheme extracts the scheme from a URL, e.g. "javascript" from
+// "javascript:alert(1)". It returns ok=false for scheme-relative and
+// relative URLs, which are always safe with respect to script-executing
+// schemes.
+func urlScheme(s string) (string, bool) {
+	n := strings.IndexAny(s, ":/?#")
+	if n < 0 || s[n] != ':' {
+		return "", false
+	}
+	scheme := s[:n]
+	for _, c := range scheme {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '+' && c != '-' && c != '.' {
+			return "", false
+		}
+	}
+	return strings.ToLower(scheme), true
+}
+
+var attrSafeReplacer = strings.NewReplacer(
+	`"`, "&#34;",
+	"'", "&#39;",
+	"`", "&#96;",
+	" ", "&#32;",
+	"\t", "&#9;",
+	"\n", "&#10;",
+)
+
+var cssSafeReplacer = strings.NewReplacer(
+	`"`, `\"`,
+	"'", `\'`,
+	"\\", `\\`,
+	"\n", `\A `,
+)
@@ -0,0 +1,56 @@
+package qtast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rawTag is one `{% name contents %}` occurrence.
+type rawTag struct {
+	name     string
+	contents string
+}
+
+// lexer splits .qtpl source into an alternating stream of text runs and
+// tags. It only needs to find tag boundaries - the contents of a tag
+// (a Go expression or statement) are handed to go/parser by the caller,
+// not by the lexer itself.
+type lexer struct {
+	src []byte
+	pos int
+}
+
+func newLexer(src []byte) *lexer {
+	return &lexer{src: src}
+}
+
+// next returns the next text run, or (nil, tag, true) when a tag is next,
+// or (nil, rawTag{}, false) at EOF.
+func (l *lexer) next() (text []byte, tag rawTag, ok bool, err error) {
+	if l.pos >= len(l.src) {
+		return nil, rawTag{}, false, nil
+	}
+	rest := l.src[l.pos:]
+	n := strings.Index(string(rest), "{%")
+	if n < 0 {
+		text = rest
+		l.pos = len(l.src)
+		return text, rawTag{}, false, nil
+	}
+	if n > 0 {
+		text = rest[:n]
+		l.pos += n
+		return text, rawTag{}, false, nil
+	}
+	end := strings.Index(string(rest), "%}")
+	if end < 0 {
+		return nil, rawTag{}, false, fmt.Errorf("unterminated tag at offset %d", l.pos)
+	}
+	body := strings.TrimSpace(string(rest[2:end]))
+	l.pos += end + 2
+	name, contents := body, ""
+	if sp := strings.IndexAny(body, " \t\r\n"); sp >= 0 {
+		name, contents = body[:sp], strings.TrimSpace(body[sp+1:])
+	}
+	return nil, rawTag{name: name, contents: contents}, true, nil
+}
@@ -0,0 +1,292 @@
+package qtast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse builds a File from .qtpl source. It runs its own lightweight tag
+// lexer (lex.go) rather than reaching into qtc's internal scanner, so
+// that qtast - and anything built on it, like qtfmt or an editor plugin -
+// has no dependency on qtc's unexported types.
+func Parse(filePath string, src []byte) (*File, error) {
+	b := &builder{l: newLexer(src), filePath: filePath}
+	f := &File{}
+	first := true
+	for {
+		text, tag, isTag, err := b.l.next()
+		if err != nil {
+			return nil, b.errf(err.Error())
+		}
+		if !isTag && text == nil {
+			break
+		}
+		if !isTag {
+			if len(strings.TrimSpace(string(text))) > 0 {
+				return nil, b.errf("unexpected text outside {%% func %%} at %q", text)
+			}
+			continue
+		}
+		isFirst := first
+		first = false
+		switch tag.name {
+		case "extends":
+			if !isFirst {
+				return nil, b.errf("extends must be the first tag in the file")
+			}
+			f.Extends = &Extends{Path: strings.Trim(tag.contents, `"`)}
+		case "import":
+			f.Imports = append(f.Imports, &Import{Path: strings.Trim(tag.contents, `"`)})
+		case "code":
+			f.Decls = append(f.Decls, &Code{Source: tag.contents})
+		case "interface", "iface":
+			n, err := b.parseInterface(tag.contents)
+			if err != nil {
+				return nil, err
+			}
+			f.Decls = append(f.Decls, n)
+		case "func":
+			n, err := b.parseFunc(tag.contents)
+			if err != nil {
+				return nil, err
+			}
+			f.Decls = append(f.Decls, n)
+		case "block":
+			n, err := b.parseBlock(tag.contents)
+			if err != nil {
+				return nil, err
+			}
+			f.Decls = append(f.Decls, n)
+		default:
+			return nil, b.errf("unexpected tag %q outside func", tag.name)
+		}
+	}
+	return f, nil
+}
+
+type builder struct {
+	l        *lexer
+	filePath string
+}
+
+func (b *builder) errf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", b.filePath, fmt.Sprintf(format, args...))
+}
+
+// parseInterface builds an Interface from a whole `{% interface Foo { ...
+// methods... } %}` tag's contents - unlike func/if/for, the interface's
+// entire body lives inside its single opening tag, there's no separate
+// {% endinterface %} in qtc's grammar.
+func (b *builder) parseInterface(contents string) (*Interface, error) {
+	n := strings.IndexByte(contents, '{')
+	if n < 0 {
+		return nil, b.errf("missing '{' in interface %q", contents)
+	}
+	name := strings.TrimSpace(contents[:n])
+	body := strings.TrimSpace(contents[n+1:])
+	body = strings.TrimSuffix(body, "}")
+	var methods []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			methods = append(methods, line)
+		}
+	}
+	return &Interface{Name: name, Methods: methods}, nil
+}
+
+func (b *builder) parseFunc(signature string) (*Func, error) {
+	body, err := b.parseBody("endfunc")
+	if err != nil {
+		return nil, err
+	}
+	return &Func{Signature: signature, Body: body}, nil
+}
+
+// parseBody parses template markup (text runs, output tags, control flow)
+// until it hits a tag named end, returning the accumulated nodes. end is
+// consumed.
+func (b *builder) parseBody(end string) ([]Node, error) {
+	var nodes []Node
+	for {
+		text, tag, isTag, err := b.l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !isTag && text == nil {
+			return nil, b.errf("missing {%% %s %%}", end)
+		}
+		if !isTag {
+			nodes = append(nodes, &Text{Value: text})
+			continue
+		}
+		if tag.name == end {
+			return nodes, nil
+		}
+		n, done, err := b.parseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if done != nil {
+			return nodes, fmt.Errorf("unexpected %q while looking for %q", *done, end)
+		}
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+// parseTag builds the Node for a single tag that appears inside a body
+// (func/if/for/switch-case), recursing into nested blocks as needed.
+func (b *builder) parseTag(tag rawTag) (Node, *string, error) {
+	name, prec := splitFilterPrec(tag.name)
+	switch name {
+	case "s", "v", "d", "f", "q", "z", "j", "u",
+		"s=", "v=", "d=", "f=", "q=", "z=", "j=", "u=",
+		"sz", "qz", "jz", "uz", "sz=", "qz=", "jz=", "uz=", "=":
+		return &OutputTag{Filter: name, Precision: prec, Expr: tag.contents}, nil, nil
+	case "if":
+		n, err := b.parseIf(tag.contents)
+		return n, nil, err
+	case "for":
+		body, err := b.parseBody("endfor")
+		if err != nil {
+			return nil, nil, err
+		}
+		return &For{Stmt: tag.contents, Body: body}, nil, nil
+	case "switch":
+		n, err := b.parseSwitch(tag.contents)
+		return n, nil, err
+	case "code":
+		return &Code{Source: tag.contents}, nil, nil
+	case "return", "break", "continue":
+		return &Code{Source: tag.name + " " + tag.contents}, nil, nil
+	case "autoescape":
+		return &Autoescape{Mode: tag.contents}, nil, nil
+	case "endautoescape":
+		return &EndAutoescape{}, nil, nil
+	case "include":
+		return &Include{Path: strings.Trim(tag.contents, `"`)}, nil, nil
+	case "block":
+		n, err := b.parseBlock(tag.contents)
+		return n, nil, err
+	default:
+		return nil, &tag.name, nil
+	}
+}
+
+// parseBlock builds a Block from a `{% block name %}` ... `{% endblock %}`
+// section. It's shared between top-level parsing (extends-child files,
+// where a block is an override) and parseTag (base templates, where a
+// block is a named region inside a func body) since the grammar is the
+// same in both places.
+func (b *builder) parseBlock(name string) (*Block, error) {
+	body, err := b.parseBody("endblock")
+	if err != nil {
+		return nil, err
+	}
+	return &Block{Name: strings.TrimSpace(name), Body: body}, nil
+}
+
+func (b *builder) parseIf(cond string) (*If, error) {
+	n := &If{Cond: cond}
+	cur := &n.Body
+	for {
+		text, tag, isTag, err := b.l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !isTag && text == nil {
+			return nil, b.errf("missing {%% endif %%} for if %q", cond)
+		}
+		if !isTag {
+			*cur = append(*cur, &Text{Value: text})
+			continue
+		}
+		switch tag.name {
+		case "endif":
+			return n, nil
+		case "else":
+			n.ElseBody = []Node{}
+			cur = &n.ElseBody
+		case "elseif":
+			n.ElseIfs = append(n.ElseIfs, ElseIf{Cond: tag.contents})
+			cur = &n.ElseIfs[len(n.ElseIfs)-1].Body
+		default:
+			child, done, err := b.parseTag(tag)
+			if err != nil {
+				return nil, err
+			}
+			if done != nil {
+				return nil, b.errf("unexpected %q inside if %q", *done, cond)
+			}
+			if child != nil {
+				*cur = append(*cur, child)
+			}
+		}
+	}
+}
+
+func (b *builder) parseSwitch(stmt string) (*Switch, error) {
+	n := &Switch{Stmt: stmt}
+	var cur *[]Node
+	for {
+		text, tag, isTag, err := b.l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !isTag && text == nil {
+			return nil, b.errf("missing {%% endswitch %%} for switch %q", stmt)
+		}
+		if !isTag {
+			if cur != nil {
+				*cur = append(*cur, &Text{Value: text})
+			}
+			continue
+		}
+		switch tag.name {
+		case "endswitch":
+			return n, nil
+		case "case":
+			n.Cases = append(n.Cases, Case{Expr: tag.contents})
+			cur = &n.Cases[len(n.Cases)-1].Body
+		case "default":
+			n.Cases = append(n.Cases, Case{IsDefault: true})
+			cur = &n.Cases[len(n.Cases)-1].Body
+		default:
+			if cur == nil {
+				return nil, b.errf("tag %q found before first case/default in switch %q", tag.name, stmt)
+			}
+			child, done, err := b.parseTag(tag)
+			if err != nil {
+				return nil, err
+			}
+			if done != nil {
+				return nil, b.errf("unexpected %q inside switch %q", *done, stmt)
+			}
+			if child != nil {
+				*cur = append(*cur, child)
+			}
+		}
+	}
+}
+
+// splitFilterPrec splits a tag name like "f.2" into ("f", 2), mirroring
+// qtc's own splitTagNamePrec.
+func splitFilterPrec(name string) (string, int) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 || parts[0] != "f" {
+		return name, -1
+	}
+	p := strings.TrimSuffix(parts[1], "=")
+	prec, err := strconv.Atoi(p)
+	if err != nil || prec < 0 {
+		return name, -1
+	}
+	suffix := ""
+	if strings.HasSuffix(parts[1], "=") {
+		suffix = "="
+	}
+	return "f" + suffix, prec
+}
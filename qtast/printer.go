@@ -0,0 +1,179 @@
+package qtast
+
+import (
+	"fmt"
+	"io"
+)
+
+func indent(w io.Writer, depth int) {
+	for i := 0; i < depth; i++ {
+		fmt.Fprint(w, "\t")
+	}
+}
+
+func fprintNodes(w io.Writer, nodes []Node, depth int) error {
+	for _, n := range nodes {
+		if err := n.Fprint(w, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fprint prints the whole file: extends (if any), then imports, then
+// top-level declarations in source order.
+func (f *File) Fprint(w io.Writer, depth int) error {
+	if f.Extends != nil {
+		if err := f.Extends.Fprint(w, depth); err != nil {
+			return err
+		}
+	}
+	for _, imp := range f.Imports {
+		if err := imp.Fprint(w, depth); err != nil {
+			return err
+		}
+	}
+	if len(f.Imports) > 0 {
+		fmt.Fprintln(w)
+	}
+	return fprintNodes(w, f.Decls, depth)
+}
+
+func (n *Import) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintf(w, "{%% import %q %%}\n", n.Path)
+	return err
+}
+
+func (n *Code) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintf(w, "{%% code %s %%}\n", FormatGoCode(n.Source))
+	return err
+}
+
+func (n *Func) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% func %s %%}\n", n.Signature)
+	if err := fprintNodes(w, n.Body, depth+1); err != nil {
+		return err
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "{% endfunc %}")
+	return nil
+}
+
+func (n *Interface) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% interface %s {\n", n.Name)
+	for _, m := range n.Methods {
+		indent(w, depth+1)
+		fmt.Fprintln(w, m)
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "} %}")
+	return nil
+}
+
+func (n *Text) Fprint(w io.Writer, depth int) error {
+	_, err := w.Write(n.Value)
+	return err
+}
+
+func (n *OutputTag) Fprint(w io.Writer, depth int) error {
+	tag := n.Filter
+	if (tag == "f" || tag == "f=") && n.Precision >= 0 {
+		tag = fmt.Sprintf("f.%d%s", n.Precision, tag[1:])
+	}
+	_, err := fmt.Fprintf(w, "{%%%s %s %%}", tag, FormatGoExpr(n.Expr))
+	return err
+}
+
+func (n *If) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% if %s %%}\n", FormatGoExpr(n.Cond))
+	if err := fprintNodes(w, n.Body, depth+1); err != nil {
+		return err
+	}
+	for _, ei := range n.ElseIfs {
+		indent(w, depth)
+		fmt.Fprintf(w, "{%% elseif %s %%}\n", FormatGoExpr(ei.Cond))
+		if err := fprintNodes(w, ei.Body, depth+1); err != nil {
+			return err
+		}
+	}
+	if n.ElseBody != nil {
+		indent(w, depth)
+		fmt.Fprintln(w, "{% else %}")
+		if err := fprintNodes(w, n.ElseBody, depth+1); err != nil {
+			return err
+		}
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "{% endif %}")
+	return nil
+}
+
+func (n *For) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% for %s %%}\n", FormatGoExpr(n.Stmt))
+	if err := fprintNodes(w, n.Body, depth+1); err != nil {
+		return err
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "{% endfor %}")
+	return nil
+}
+
+func (n *Autoescape) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintf(w, "{%% autoescape %s %%}\n", n.Mode)
+	return err
+}
+
+func (n *EndAutoescape) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintln(w, "{% endautoescape %}")
+	return err
+}
+
+func (n *Include) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintf(w, "{%% include %q %%}\n", n.Path)
+	return err
+}
+
+func (n *Block) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% block %s %%}\n", n.Name)
+	if err := fprintNodes(w, n.Body, depth+1); err != nil {
+		return err
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "{% endblock %}")
+	return nil
+}
+
+func (n *Extends) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	_, err := fmt.Fprintf(w, "{%% extends %q %%}\n", n.Path)
+	return err
+}
+
+func (n *Switch) Fprint(w io.Writer, depth int) error {
+	indent(w, depth)
+	fmt.Fprintf(w, "{%% switch %s %%}\n", FormatGoExpr(n.Stmt))
+	for _, c := range n.Cases {
+		indent(w, depth)
+		if c.IsDefault {
+			fmt.Fprintln(w, "{% default %}")
+		} else {
+			fmt.Fprintf(w, "{%% case %s %%}\n", FormatGoExpr(c.Expr))
+		}
+		if err := fprintNodes(w, c.Body, depth+1); err != nil {
+			return err
+		}
+	}
+	indent(w, depth)
+	fmt.Fprintln(w, "{% endswitch %}")
+	return nil
+}
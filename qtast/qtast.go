@@ -0,0 +1,190 @@
+// Package qtast builds an in-memory representation of a .qtpl template's
+// structure (funcs, interfaces, imports, code blocks, control flow and
+// output tags) and prints it back out in a canonical form.
+//
+// qtc's parser writes Go code directly as it scans a template and keeps
+// no tree of the template's structure. qtast exists so that other tools
+// - the qtfmt formatter, editor plugins, LSPs - can build and print that
+// tree without depending on qtc's code generator.
+package qtast
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io"
+	"strings"
+)
+
+// Node is implemented by every element that can appear in a template.
+type Node interface {
+	// Fprint writes the canonical text representation of the node to w,
+	// indented at the given depth (in tabs).
+	Fprint(w io.Writer, depth int) error
+}
+
+// File is the root of a parsed .qtpl file.
+type File struct {
+	Extends *Extends // non-nil when the file starts with {% extends %}
+	Imports []*Import
+	Decls   []Node // *Interface, *Code, *Func, *Block (extends-child files only)
+}
+
+// Import is a `{% import "..." %}` tag.
+type Import struct {
+	Path string
+}
+
+// Code is a `{% code %}` block at file or func scope.
+type Code struct {
+	Source string
+}
+
+// Func is a `{% func Name(...) %}` ... `{% endfunc %}` block.
+type Func struct {
+	Signature string // e.g. "Foo(w io.Writer, name string)"
+	Body      []Node
+}
+
+// Interface is a `{% interface Name { ... } %}` block.
+type Interface struct {
+	Name    string
+	Methods []string
+}
+
+// Text is a run of literal template text between tags.
+type Text struct {
+	Value []byte
+}
+
+// OutputTag is `{%= expr %}`, `{%s expr %}`, `{%v expr %}`, etc, including
+// its filter, precision and equal-sign spelling.
+type OutputTag struct {
+	Filter    string // tag name without precision, e.g. "s", "s=", "qz", "f", "f=", "="
+	Precision int    // -1 when absent, e.g. for {%f.2 expr %}
+	Expr      string
+}
+
+// If is an `{% if %}` ... `{% elseif %}` ... `{% else %}` ... `{% endif %}`.
+type If struct {
+	Cond     string
+	Body     []Node
+	ElseIfs  []ElseIf
+	ElseBody []Node
+}
+
+// ElseIf is one `{% elseif cond %}` branch of an If.
+type ElseIf struct {
+	Cond string
+	Body []Node
+}
+
+// For is a `{% for %}` ... `{% endfor %}` block.
+type For struct {
+	Stmt string
+	Body []Node
+}
+
+// Switch is a `{% switch %}` ... `{% endswitch %}` block.
+type Switch struct {
+	Stmt  string
+	Cases []Case
+}
+
+// Case is one `{% case %}` or `{% default %}` branch of a Switch.
+type Case struct {
+	Expr      string // empty for default
+	IsDefault bool
+	Body      []Node
+}
+
+// Autoescape is a `{% autoescape mode %}` tag that turns on context-aware
+// autoescaping for subsequent output tags up to the matching
+// EndAutoescape. It mirrors qtc's own flat treatment of the pair: unlike
+// If/For/Switch, the nodes in between aren't collected as this node's
+// children - they stay siblings in whatever body it appears in.
+type Autoescape struct {
+	Mode string
+}
+
+// EndAutoescape is the `{% endautoescape %}` tag closing an Autoescape.
+type EndAutoescape struct{}
+
+// Include is a `{% include "path/to/other.qtpl" %}` tag.
+type Include struct {
+	Path string
+}
+
+// Block is a `{% block name %}` ... `{% endblock %}` section: a named,
+// independently overridable region of a func body, or - in a file that
+// starts with {% extends %} - an override of a same-named block in the
+// base template.
+type Block struct {
+	Name string
+	Body []Node
+}
+
+// Extends is a file-level `{% extends "base.qtpl" %}` tag. When present
+// it must be the first tag in the file, and the file's declarations are
+// Block overrides rather than funcs/interfaces/code.
+type Extends struct {
+	Path string
+}
+
+// FormatGoExpr runs expr through go/parser and go/printer so that
+// expressions embedded in tags come out with canonical Go formatting.
+// Expressions that fail to parse (e.g. they're statements, not
+// expressions) are returned unchanged.
+func FormatGoExpr(expr string) string {
+	e, err := goparser.ParseExpr(expr)
+	if err != nil {
+		return expr
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, gotoken.NewFileSet(), e); err != nil {
+		return expr
+	}
+	return buf.String()
+}
+
+// FormatGoCode runs a snippet of Go statements through gofmt by wrapping
+// it in a throwaway function body. Only syntax is checked, so snippets
+// that reference undeclared identifiers are formatted too; snippets that
+// fail to parse as Go statements are returned unchanged.
+//
+// The wrapper's own lines are located by content ("func _() {" and the
+// function's closing "}") rather than by an assumed line offset, since
+// format.Source is free to add or remove blank lines (e.g. after
+// "package p") that would otherwise shift a fixed offset out from under
+// the real body.
+func FormatGoCode(code string) string {
+	wrapped := fmt.Sprintf("package p\n\nfunc _() {\n%s\n}\n", code)
+	out, err := format.Source([]byte(wrapped))
+	if err != nil {
+		return code
+	}
+	lines := strings.Split(string(out), "\n")
+	start, end := -1, -1
+	for i, line := range lines {
+		if start < 0 {
+			if strings.HasPrefix(line, "func _() {") {
+				start = i + 1
+			}
+			continue
+		}
+		if line == "}" {
+			end = i
+			break
+		}
+	}
+	if start < 0 || end < 0 || start > end {
+		return code
+	}
+	body := lines[start:end]
+	for i, line := range body {
+		body[i] = strings.TrimPrefix(line, "\t")
+	}
+	return strings.Join(body, "\n")
+}
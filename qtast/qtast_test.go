@@ -0,0 +1,48 @@
+package qtast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatGoCode(t *testing.T) {
+	got := FormatGoCode("x:=1\nif x>0 {\nfmt.Println(x)\n}")
+	want := "x := 1\nif x > 0 {\n\tfmt.Println(x)\n}"
+	if got != want {
+		t.Fatalf("FormatGoCode returned %q, want %q", got, want)
+	}
+}
+
+func TestFormatGoExpr(t *testing.T) {
+	got := FormatGoExpr("1+2")
+	if got != "1 + 2" {
+		t.Fatalf("FormatGoExpr returned %q, want %q", got, "1 + 2")
+	}
+}
+
+func TestParseAndFprintRoundTrip(t *testing.T) {
+	src := []byte(`{% func Hello(name string) %}
+Hello, {%s name %}!
+{% if name != "" %}
+known
+{% else %}
+unknown
+{% endif %}
+{% endfunc %}
+`)
+	f, err := Parse("t.qtpl", src)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := f.Fprint(&buf, 0); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"{% func Hello(name string) %}", "{%s name %}", "{% if name != \"\" %}", "{% else %}", "{% endif %}", "{% endfunc %}"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q, got:\n%s", want, out)
+		}
+	}
+}
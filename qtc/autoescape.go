@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// htmlContext identifies the kind of text an output tag is about to be
+// interpolated into, so autoescape mode can pick a filter that's actually
+// safe for that sink instead of the generic HTML-body escaper.
+type htmlContext int
+
+const (
+	htmlContextText htmlContext = iota
+	htmlContextAttrUnquoted
+	htmlContextAttrSingle
+	htmlContextAttrDouble
+	htmlContextURLAttr
+	htmlContextScript
+	htmlContextStyle
+)
+
+// autoescapeState tracks the current htmlContext for a single
+// `{% autoescape html %}` ... `{% endautoescape %}` region by scanning the
+// literal text runs emitted via emitText.
+type autoescapeState struct {
+	ctx     htmlContext
+	urlAttr bool // true once inside an href=/src=/action= value
+}
+
+var (
+	tagOpenRe   = regexp.MustCompile(`(?i)<(script|style)[^>]*>`)
+	tagCloseRe  = regexp.MustCompile(`(?i)</(script|style)>`)
+	attrStartRe = regexp.MustCompile(`(?i)([a-zA-Z_-]+)\s*=\s*(["']?)`)
+)
+
+// urlAttrNames lists attributes whose value is a URL, so an interpolation
+// there needs URL-component escaping instead of plain attribute escaping.
+var urlAttrNames = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true,
+}
+
+// advance updates ctx by scanning the literal text that was just emitted,
+// so that the *next* output tag in the template sees the right context.
+//
+// It processes the whole chunk in a loop rather than just inspecting its
+// end: a chunk can contain a full attribute (entered and closed within
+// the same literal run, e.g. "<div id=\"x\" "), or it can open an
+// attribute value with a non-empty literal prefix before the tag that
+// interpolates into it (e.g. "<a href=\"/user/"). Re-deriving the
+// context from only the tail of each chunk would miss that second case
+// and silently fall back to the generic escaper.
+func (a *autoescapeState) advance(text []byte) {
+	for len(text) > 0 {
+		switch a.ctx {
+		case htmlContextText:
+			tagLoc := tagOpenRe.FindSubmatchIndex(text)
+			attrLoc := attrStartRe.FindSubmatchIndex(text)
+			switch {
+			case tagLoc != nil && (attrLoc == nil || tagLoc[0] <= attrLoc[0]):
+				if bytes.EqualFold(text[tagLoc[2]:tagLoc[3]], []byte("script")) {
+					a.ctx = htmlContextScript
+				} else {
+					a.ctx = htmlContextStyle
+				}
+				text = text[tagLoc[1]:]
+			case attrLoc != nil:
+				name := string(bytes.ToLower(text[attrLoc[2]:attrLoc[3]]))
+				a.urlAttr = urlAttrNames[name]
+				switch string(text[attrLoc[4]:attrLoc[5]]) {
+				case `"`:
+					a.ctx = htmlContextAttrDouble
+				case `'`:
+					a.ctx = htmlContextAttrSingle
+				default:
+					a.ctx = htmlContextAttrUnquoted
+				}
+				text = text[attrLoc[1]:]
+			default:
+				return
+			}
+		case htmlContextAttrDouble:
+			n := bytes.IndexByte(text, '"')
+			if n < 0 {
+				return
+			}
+			a.ctx = htmlContextText
+			a.urlAttr = false
+			text = text[n+1:]
+		case htmlContextAttrSingle:
+			n := bytes.IndexByte(text, '\'')
+			if n < 0 {
+				return
+			}
+			a.ctx = htmlContextText
+			a.urlAttr = false
+			text = text[n+1:]
+		case htmlContextAttrUnquoted:
+			n := bytes.IndexAny(text, " \t\r\n>")
+			if n < 0 {
+				return
+			}
+			a.ctx = htmlContextText
+			a.urlAttr = false
+			text = text[n+1:]
+		case htmlContextScript, htmlContextStyle:
+			loc := tagCloseRe.FindIndex(text)
+			if loc == nil {
+				return
+			}
+			a.ctx = htmlContextText
+			text = text[loc[1]:]
+		}
+	}
+}
+
+// filterFor returns the qw method call (already including any "E()."
+// prefix it needs) that safely escapes a value interpolated at the
+// current context, or an error if the interpolation is an impossible
+// transition that autoescape refuses to paper over.
+//
+// AttrSafe/URLSafe/JSSafe/CSSSafe are plain *QWriter methods, not chained
+// off E() - only the pre-existing S filter is.
+//
+// The error case only catches a double-quoted string literal starting with
+// "javascript: right in the template; other schemes are not checked here,
+// and it can't see a
+// variable holding the same thing, since it only has the expression's
+// source text to go on. URLSafe's own runtime scheme check (see
+// autoescape.go's URLSafe) is what catches that case - the two checks are
+// complementary, not redundant: this one gives a compile-time diagnostic
+// for the common mistake of writing the scheme inline, the other is the
+// last line of defense for a computed value.
+func (a *autoescapeState) filterFor(expr string) (string, error) {
+	switch a.ctx {
+	case htmlContextScript:
+		return "JSSafe", nil
+	case htmlContextStyle:
+		return "CSSSafe", nil
+	case htmlContextAttrUnquoted, htmlContextAttrSingle, htmlContextAttrDouble:
+		if a.urlAttr {
+			if bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace([]byte(expr))), []byte(`"javascript:`)) {
+				return "", fmt.Errorf("interpolating %q into a javascript: URL requires an explicit filter, autoescape refuses to guess one", expr)
+			}
+			return "URLSafe", nil
+		}
+		return "AttrSafe", nil
+	default:
+		return "E().S", nil
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// parseInclude handles `{% include "path/to/other.qtpl" %}`: it resolves
+// the path relative to the including file, parses the target file's body
+// inline at the include site (sharing qw/mangleSuffix with the caller),
+// and guards against include cycles via p.includeStack.
+func (p *parser) parseInclude() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	incPath := strings.Trim(strings.TrimSpace(string(t.Value)), `"`)
+	if len(incPath) == 0 {
+		return fmt.Errorf("missing include path at %s", s.Context())
+	}
+	resolved := filepath.Join(filepath.Dir(s.filePath), incPath)
+	if p.includeStack[resolved] {
+		return fmt.Errorf("include cycle detected: %q is already being included at %s", incPath, s.Context())
+	}
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return fmt.Errorf("cannot read included template %q at %s: %s", incPath, s.Context(), err)
+	}
+	p.includeStack[resolved] = true
+	defer delete(p.includeStack, resolved)
+
+	saved := p.s
+	p.s = newScanner(bytes.NewReader(data), resolved)
+	err = p.parseIncludeBody()
+	p.s = saved
+	return err
+}
+
+// parseIncludeBody renders an included file's top-level text and tags
+// inline at the include site.
+func (p *parser) parseIncludeBody() error {
+	s := p.s
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in included template %q: %s", s.filePath, err)
+			}
+			if !ok {
+				return fmt.Errorf("unexpected tag found in included template %q: %q at %s", s.filePath, t.Value, s.Context())
+			}
+		default:
+			return fmt.Errorf("unexpected token found in included template %q: %s at %s", s.filePath, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse included template %q: %s", s.filePath, err)
+	}
+	return nil
+}
+
+// parseExtends handles a file-level `{% extends "base.qtpl" %}`. It must
+// be the first token in the file: parseTemplate only recognizes it there,
+// so not even text may come before it. The rest of the file is expected to
+// contain only `{% block name %} ... {% endblock %}` overrides, which are
+// collected and then used to replace the same-named blocks while parsing
+// the base template - the base is parsed first, and its block bodies are
+// swapped out for the child's before codegen.
+func (p *parser) parseExtends() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	basePath := strings.Trim(strings.TrimSpace(string(t.Value)), `"`)
+	if len(basePath) == 0 {
+		return fmt.Errorf("missing base template path at %s", p.s.Context())
+	}
+	resolved := filepath.Join(filepath.Dir(p.s.filePath), basePath)
+	if p.includeStack[resolved] {
+		return fmt.Errorf("extends cycle detected: %q is already being parsed at %s", basePath, p.s.Context())
+	}
+
+	overrides, err := collectBlocks(p.s)
+	if err != nil {
+		return fmt.Errorf("cannot collect blocks extending %q at %s: %s", basePath, p.s.Context(), err)
+	}
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return fmt.Errorf("cannot read base template %q at %s: %s", basePath, p.s.Context(), err)
+	}
+
+	p.includeStack[resolved] = true
+	defer delete(p.includeStack, resolved)
+
+	base := &parser{
+		s:              newScanner(bytes.NewReader(data), resolved),
+		w:              p.w,
+		packageName:    p.packageName,
+		lineDirectives: p.lineDirectives,
+		blockOverrides: overrides,
+		includeStack:   p.includeStack,
+	}
+	return base.parseTemplate()
+}
+
+// blockOverride is a child template's `{% block %}` body, reconstructed as
+// .qtpl source so it can be re-parsed against the base template's scope
+// (func depth, for/switch depth, autoescape context). filePath and line
+// record where that body actually lives in the child template, so
+// //line directives emitted while replaying it point back to the child
+// instead of the base being overridden or line 1 of the override buffer.
+type blockOverride struct {
+	body     []byte
+	filePath string
+	line     int
+}
+
+// collectBlocks scans the remainder of a child template that extends a
+// base template and returns its block overrides keyed by block name.
+func collectBlocks(s *scanner) (map[string]blockOverride, error) {
+	blocks := map[string]blockOverride{}
+	for s.Next() {
+		t := s.Token()
+		if t.ID != tagName {
+			continue
+		}
+		if string(t.Value) != "block" {
+			if _, err := expectTagContents(s); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		nameTok, err := expectTagContents(s)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSpace(string(nameTok.Value))
+		if len(name) == 0 {
+			return nil, fmt.Errorf("missing block name at %s", s.Context())
+		}
+		bodyLine := s.Pos().Line
+		var buf bytes.Buffer
+		if err := reconstructBlockBody(s, &buf); err != nil {
+			return nil, fmt.Errorf("error in block %q: %s", name, err)
+		}
+		blocks[name] = blockOverride{body: buf.Bytes(), filePath: s.filePath, line: bodyLine}
+	}
+	if err := s.LastError(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// reconstructBlockBody rebuilds the .qtpl source of a {% block %} body
+// from the already-tokenized stream, up to and including its matching
+// {% endblock %}.
+func reconstructBlockBody(s *scanner, buf *bytes.Buffer) error {
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			buf.Write(t.Value)
+		case tagName:
+			name := string(t.Value)
+			if name == "endblock" {
+				return skipTagContents(s)
+			}
+			ct, err := expectTagContents(s)
+			if err != nil {
+				return err
+			}
+			if len(ct.Value) == 0 {
+				fmt.Fprintf(buf, "{%% %s %%}", name)
+			} else {
+				fmt.Fprintf(buf, "{%% %s %s %%}", name, ct.Value)
+			}
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return err
+	}
+	return fmt.Errorf("cannot find endblock tag at %s", s.Context())
+}
+
+// parseBlock handles `{% block name %} ... {% endblock %}`. When the
+// current parse has an override for name (because the original template
+// being compiled `{% extends %}` this one), the override's content is
+// rendered in place of this block's own body, which is then skipped.
+func (p *parser) parseBlock() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(string(t.Value))
+	if len(name) == 0 {
+		return fmt.Errorf("missing block name at %s", s.Context())
+	}
+	blockStr := "block " + name
+
+	override, hasOverride := p.blockOverrides[name]
+	if !hasOverride {
+		return p.parseBlockBody(blockStr)
+	}
+
+	savedScanner, savedDelta := p.s, p.lineDelta
+	p.s = newScanner(bytes.NewReader(override.body), override.filePath)
+	p.lineDelta = override.line - 1
+	err = p.parseBlockBody(blockStr)
+	p.s, p.lineDelta = savedScanner, savedDelta
+	if err != nil {
+		return err
+	}
+	return p.skipBlockBody(name)
+}
+
+func (p *parser) parseBlockBody(blockStr string) error {
+	s := p.s
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %s", blockStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endblock":
+				return skipTagContents(s)
+			default:
+				return fmt.Errorf("unexpected tag found in %q: %q at %s", blockStr, t.Value, s.Context())
+			}
+		default:
+			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", blockStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %s", blockStr, err)
+	}
+	return fmt.Errorf("cannot find endblock tag for %q at %s", blockStr, s.Context())
+}
+
+// skipBlockBody discards the base template's own block body - already
+// rendered from the child's override by parseBlock - up to and including
+// its {% endblock %}.
+func (p *parser) skipBlockBody(name string) error {
+	s := p.s
+	for s.Next() {
+		t := s.Token()
+		if t.ID == tagName {
+			if string(t.Value) == "endblock" {
+				return skipTagContents(s)
+			}
+			if _, err := expectTagContents(s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot skip block %q body: %s", name, err)
+	}
+	return fmt.Errorf("cannot find endblock tag for block %q at %s", name, s.Context())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	goscanner "go/scanner"
+)
+
+// errorf records a diagnostic at the parser's current position instead of
+// aborting the whole parse. It lets parseTemplate keep going after a
+// broken tag so a single qtc invocation can report every error in a
+// template tree, not just the first one.
+func (p *parser) errorf(format string, args ...interface{}) {
+	p.errs.Add(p.s.Pos(), fmt.Sprintf(format, args...))
+}
+
+// synchronize skips tokens until it finds one of the given top-level tag
+// names (or a new {% func %}), so parsing can resume after a malformed
+// tag instead of bailing out of the whole file. It returns without error
+// once resynchronized, or once input is exhausted.
+func (p *parser) synchronize(tagNames ...string) {
+	s := p.s
+	want := make(map[string]bool, len(tagNames)+1)
+	for _, n := range tagNames {
+		want[n] = true
+	}
+	want["func"] = true
+	for s.Next() {
+		t := s.Token()
+		if t.ID == tagName && want[string(t.Value)] {
+			s.Rewind()
+			return
+		}
+	}
+}
+
+// errorList exposes the accumulated diagnostics as a sorted
+// go/scanner.ErrorList, which callers such as qtc's main package can
+// print with scanner.PrintError for file:line:col output.
+func (p *parser) errorList() goscanner.ErrorList {
+	p.errs.Sort()
+	return p.errs
+}
+
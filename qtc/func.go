@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"strings"
+)
+
+// funcType represents a parsed {% func %} declaration or interface
+// method, e.g. "Foo[T any, K comparable](w io.Writer, x T)". TypeParams
+// is "" for non-generic funcs and interface methods, which can't declare
+// their own type parameters in Go - only the enclosing {% func %} or
+// {% interface %} can be generic.
+type funcType struct {
+	Name       string
+	TypeParams string   // e.g. "[T any, K comparable]"
+	typeArgs   string   // e.g. "[T, K]", for building call sites; "" if not generic
+	Args       string   // raw argument list source, e.g. "w io.Writer, x T"
+	ArgNames   []string // e.g. ["w", "x"], for building call sites
+}
+
+// parseFuncDef parses a {% func %} declaration or interface method using
+// go/parser, so the grammar - including Go 1.18+ type parameter lists -
+// stays in sync with the real Go spec instead of a hand-rolled parser.
+func parseFuncDef(decl []byte) (*funcType, error) {
+	declStr := strings.TrimSpace(string(decl))
+	name, typeParams, rest, err := splitFuncNameTypeParams(declStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type parameters in %q: %s", declStr, err)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("missing function name in %q", declStr)
+	}
+	args, argNames, err := parseFuncArgs(rest)
+	if err != nil {
+		return nil, fmt.Errorf("error when parsing args of %q: %s", declStr, err)
+	}
+	typeArgs, err := typeArgNames(typeParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type parameters in %q: %s", declStr, err)
+	}
+	return &funcType{Name: name, TypeParams: typeParams, typeArgs: typeArgs, Args: args, ArgNames: argNames}, nil
+}
+
+// splitFuncNameTypeParams splits a declaration into its name, an optional
+// bracketed type parameter list, and the remaining "(args)" source, and
+// validates the type parameter list (if any) via splitTypeParams.
+func splitFuncNameTypeParams(decl string) (name, typeParams, rest string, err error) {
+	i := strings.IndexAny(decl, "[(")
+	if i < 0 || decl[i] == '(' {
+		if i < 0 {
+			return decl, "", "", nil
+		}
+		return decl[:i], "", decl[i:], nil
+	}
+	depth := 0
+	end := -1
+	for k := i; k < len(decl); k++ {
+		switch decl[k] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = k
+			}
+		}
+		if end >= 0 {
+			break
+		}
+	}
+	if end < 0 {
+		return "", "", "", fmt.Errorf("unbalanced '[' in %q", decl)
+	}
+	name = decl[:i]
+	typeParams = decl[i : end+1]
+	rest = decl[end+1:]
+	if _, _, verr := splitTypeParams(strings.TrimSpace(name) + typeParams); verr != nil {
+		return "", "", "", verr
+	}
+	return name, typeParams, rest, nil
+}
+
+// parseFuncArgs parses a "(args)" source fragment and returns the raw
+// argument list text (for re-emitting in a def) plus the bare argument
+// names (for re-emitting in a call).
+func parseFuncArgs(argsSrc string) (args string, argNames []string, err error) {
+	src := "package p\nfunc f" + argsSrc + " {}\n"
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	fd, ok := f.Decls[0].(*ast.FuncDecl)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected declaration shape: %T", f.Decls[0])
+	}
+	params := fd.Type.Params
+	if params == nil || len(params.List) == 0 {
+		return "", nil, nil
+	}
+	startOff := fset.Position(params.Opening).Offset + 1
+	endOff := fset.Position(params.Closing).Offset
+	args = src[startOff:endOff]
+	for _, field := range params.List {
+		if len(field.Names) == 0 {
+			return "", nil, fmt.Errorf("unnamed argument in %q", argsSrc)
+		}
+		for _, n := range field.Names {
+			argNames = append(argNames, n.Name)
+		}
+	}
+	return args, argNames, nil
+}
+
+func (f *funcType) defSignature(name, firstArg string) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteString(f.TypeParams)
+	sb.WriteByte('(')
+	sb.WriteString(firstArg)
+	if f.Args != "" {
+		sb.WriteString(", ")
+		sb.WriteString(f.Args)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// DefStream returns the signature of the StreamXxx variant, e.g.
+// "StreamFoo[T any](qw *qt.Writer, x T)".
+func (f *funcType) DefStream(qwName string) string {
+	return f.defSignature("Stream"+f.Name, fmt.Sprintf("%s *qt%s.Writer", qwName, mangleSuffix))
+}
+
+// DefWrite returns the signature of the WriteXxx variant, e.g.
+// "WriteFoo[T any](qq io.Writer, x T)".
+func (f *funcType) DefWrite(qqName string) string {
+	return f.defSignature("Write"+f.Name, fmt.Sprintf("%s qtio%s.Writer", qqName, mangleSuffix))
+}
+
+// DefString returns the signature of the string-returning variant, e.g.
+// "Foo[T any](x T) string".
+func (f *funcType) DefString() string {
+	return f.Name + f.TypeParams + "(" + f.Args + ") string"
+}
+
+// callExpr builds a call to a sibling variant, instantiated with the bare
+// type parameter names (f.typeArgs) rather than the full declaration list
+// (f.TypeParams): call-site type arguments must be type expressions, and
+// a constraint such as "comparable" isn't one.
+func (f *funcType) callExpr(name, firstArg string) string {
+	args := append([]string{firstArg}, f.ArgNames...)
+	return name + f.typeArgs + "(" + strings.Join(args, ", ") + ")"
+}
+
+// CallStream returns a call to the StreamXxx variant, e.g.
+// "StreamFoo[T](qw, x)".
+func (f *funcType) CallStream(qwName string) string {
+	return f.callExpr("Stream"+f.Name, qwName)
+}
+
+// CallWrite returns a call to the WriteXxx variant, e.g.
+// "WriteFoo[T](qq, x)".
+func (f *funcType) CallWrite(qqName string) string {
+	return f.callExpr("Write"+f.Name, qqName)
+}
+
+// funcCallType represents a `{%= FuncCall(args) %}` call expression,
+// including an optional explicit generic instantiation such as
+// "Foo[int](x, y)".
+type funcCallType struct {
+	Name     string
+	TypeArgs string // e.g. "[int]", or "" when not explicitly instantiated
+	Args     string // raw call argument list source
+}
+
+// parseFuncCall parses a `{%= %}` call expression using go/parser. It
+// parses the expression as the value of a throwaway var declaration in a
+// full file and slices the type arguments and call arguments back out of
+// that source by their FileSet offsets.
+func parseFuncCall(callSrc []byte) (*funcCallType, error) {
+	exprStr := strings.TrimSpace(string(callSrc))
+	fset := gotoken.NewFileSet()
+	src := "package p\nvar _ = " + exprStr + "\n"
+	f, err := goparser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	gd, ok := f.Decls[0].(*ast.GenDecl)
+	if !ok || len(gd.Specs) != 1 {
+		return nil, fmt.Errorf("unexpected declaration shape for %q", exprStr)
+	}
+	vs, ok := gd.Specs[0].(*ast.ValueSpec)
+	if !ok || len(vs.Values) != 1 {
+		return nil, fmt.Errorf("unexpected value shape for %q", exprStr)
+	}
+	call, ok := vs.Values[0].(*ast.CallExpr)
+	if !ok {
+		return nil, fmt.Errorf("expected a function call, got %T", vs.Values[0])
+	}
+
+	var name, typeArgs string
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		name = fn.Name
+	case *ast.IndexExpr:
+		id, ok := fn.X.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("unsupported generic call target %T", fn.X)
+		}
+		name = id.Name
+		typeArgs = "[" + sliceSrc(src, fset, fn.Index.Pos(), fn.Index.End()) + "]"
+	case *ast.IndexListExpr:
+		id, ok := fn.X.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("unsupported generic call target %T", fn.X)
+		}
+		name = id.Name
+		typeArgs = "[" + sliceSrc(src, fset, fn.Indices[0].Pos(), fn.Indices[len(fn.Indices)-1].End()) + "]"
+	default:
+		return nil, fmt.Errorf("unsupported call target %T", call.Fun)
+	}
+
+	var args string
+	if len(call.Args) > 0 {
+		args = sliceSrc(src, fset, call.Args[0].Pos(), call.Args[len(call.Args)-1].End())
+	}
+	return &funcCallType{Name: name, TypeArgs: typeArgs, Args: args}, nil
+}
+
+func sliceSrc(src string, fset *gotoken.FileSet, start, end gotoken.Pos) string {
+	return src[fset.Position(start).Offset:fset.Position(end).Offset]
+}
+
+func (f *funcCallType) call(name, firstArg string) string {
+	if f.Args == "" {
+		return name + f.TypeArgs + "(" + firstArg + ")"
+	}
+	return name + f.TypeArgs + "(" + firstArg + ", " + f.Args + ")"
+}
+
+// CallStream returns a call to the target's StreamXxx variant, e.g.
+// "StreamFoo[int](qw, x, y)".
+func (f *funcCallType) CallStream(qwName string) string {
+	return f.call("Stream"+f.Name, qwName)
+}
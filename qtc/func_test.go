@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestParseFuncDefGenerics(t *testing.T) {
+	f, err := parseFuncDef([]byte("Cache[K comparable, V any](key K, val V)"))
+	if err != nil {
+		t.Fatalf("parseFuncDef failed: %s", err)
+	}
+	if f.Name != "Cache" {
+		t.Errorf("Name = %q, want %q", f.Name, "Cache")
+	}
+	if f.TypeParams != "[K comparable, V any]" {
+		t.Errorf("TypeParams = %q, want %q", f.TypeParams, "[K comparable, V any]")
+	}
+	if got := f.CallStream("qw"); got != "StreamCache[K, V](qw, key, val)" {
+		t.Errorf("CallStream = %q", got)
+	}
+}
+
+func TestParseFuncDefNonGeneric(t *testing.T) {
+	f, err := parseFuncDef([]byte("Foo(w io.Writer, name string)"))
+	if err != nil {
+		t.Fatalf("parseFuncDef failed: %s", err)
+	}
+	if f.TypeParams != "" {
+		t.Errorf("TypeParams = %q, want empty", f.TypeParams)
+	}
+	if got := f.CallStream("qw"); got != "StreamFoo(qw, w, name)" {
+		t.Errorf("CallStream = %q", got)
+	}
+}
+
+func TestParseFuncCallGenericInstantiation(t *testing.T) {
+	f, err := parseFuncCall([]byte("Cache[int, string](1, \"a\")"))
+	if err != nil {
+		t.Fatalf("parseFuncCall failed: %s", err)
+	}
+	if f.Name != "Cache" {
+		t.Errorf("Name = %q, want %q", f.Name, "Cache")
+	}
+	if f.TypeArgs != "[int, string]" {
+		t.Errorf("TypeArgs = %q, want %q", f.TypeArgs, "[int, string]")
+	}
+	if got := f.CallStream("qw"); got != "StreamCache[int, string](qw, 1, \"a\")" {
+		t.Errorf("CallStream = %q", got)
+	}
+}
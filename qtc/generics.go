@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"strings"
+)
+
+// splitTypeParams splits a declared name that may carry a Go 1.18+ type
+// parameter list, e.g. "Cache[K comparable, V any]", into the bare name
+// ("Cache") and the bracketed type parameter list re-rendered verbatim
+// ("[K comparable, V any]", or "" if there wasn't one).
+//
+// It's used by parseInterface for `{% interface %}` declarations and, via
+// splitFuncNameTypeParams, by parseFuncDef for `{% func %}` declarations,
+// so both accept the same generics syntax.
+func splitTypeParams(decl string) (name, typeParams string, err error) {
+	n := strings.IndexByte(decl, '[')
+	if n < 0 {
+		return decl, "", nil
+	}
+	name = strings.TrimSpace(decl[:n])
+	if len(name) == 0 {
+		return "", "", fmt.Errorf("missing name before type parameter list in %q", decl)
+	}
+	// Reuse go/parser to validate the bracketed list: parse it as the type
+	// parameters of a throwaway generic type declaration, so the grammar
+	// stays in sync with the real Go spec instead of hand-rolling a parser
+	// for constraint expressions.
+	src := fmt.Sprintf("package p\ntype %s int\n", decl)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return "", "", err
+	}
+	gd, ok := f.Decls[0].(*ast.GenDecl)
+	if !ok || len(gd.Specs) != 1 {
+		return "", "", fmt.Errorf("unexpected declaration shape for %q", decl)
+	}
+	ts, ok := gd.Specs[0].(*ast.TypeSpec)
+	if !ok || ts.TypeParams == nil {
+		return "", "", fmt.Errorf("unexpected type parameter list for %q", decl)
+	}
+	typeParams = strings.TrimSpace(decl[n:])
+	return name, typeParams, nil
+}
+
+// typeArgNames strips the constraints off a declared type parameter list,
+// e.g. "[K comparable, V any]" -> "[K, V]", for use at call sites: call-site
+// type arguments must be type expressions, and a constraint such as
+// "comparable" isn't one.
+//
+// typeParams must be the "" or "[...]" form produced by splitTypeParams; it
+// is re-parsed the same way so the two stay in sync.
+func typeArgNames(typeParams string) (string, error) {
+	if typeParams == "" {
+		return "", nil
+	}
+	src := fmt.Sprintf("package p\ntype t%s int\n", typeParams)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return "", err
+	}
+	gd, ok := f.Decls[0].(*ast.GenDecl)
+	if !ok || len(gd.Specs) != 1 {
+		return "", fmt.Errorf("unexpected declaration shape for %q", typeParams)
+	}
+	ts, ok := gd.Specs[0].(*ast.TypeSpec)
+	if !ok || ts.TypeParams == nil {
+		return "", fmt.Errorf("unexpected type parameter list for %q", typeParams)
+	}
+	var names []string
+	for _, field := range ts.TypeParams.List {
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]", nil
+}
@@ -0,0 +1,72 @@
+// Command qtc compiles .qtpl template files into .qtpl.go Go source files.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	goscanner "go/scanner"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	dir  = flag.String("dir", ".", "Directory to recursively parse for .qtpl files")
+	ext  = flag.String("ext", ".qtpl", "Only files with this extension are treated as templates")
+	line = flag.Bool("line", true, "Whether to emit //line directives pointing back to .qtpl sources")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := filepath.Walk(*dir, walkFunc); err != nil {
+		fmt.Fprintf(os.Stderr, "qtc: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func walkFunc(filePath string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || filepath.Ext(filePath) != *ext {
+		return nil
+	}
+	if err := compileFile(filePath); err != nil {
+		fmt.Fprintf(os.Stderr, "qtc: %s\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
+
+func compileFile(filePath string) error {
+	src, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %s", filePath, err)
+	}
+	packageName := filepath.Base(filepath.Dir(filePath))
+
+	var buf bytes.Buffer
+	opts := []parseOption{withLineDirectives(*line)}
+	if err := parse(&buf, bytes.NewReader(src), filePath, packageName, opts...); err != nil {
+		if errs, ok := err.(goscanner.ErrorList); ok {
+			for _, e := range errs {
+				fmt.Fprintln(os.Stderr, e)
+			}
+			return fmt.Errorf("cannot compile %q", filePath)
+		}
+		return fmt.Errorf("cannot compile %q: %s", filePath, err)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated code for %q: %s", filePath, err)
+	}
+	outPath := filePath + ".go"
+	if err := ioutil.WriteFile(outPath, formatted, 0644); err != nil {
+		return fmt.Errorf("cannot write %q: %s", outPath, err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go/ast"
 	goparser "go/parser"
+	goscanner "go/scanner"
 	gotoken "go/token"
 	"io"
 	"path/filepath"
@@ -21,19 +22,49 @@ type parser struct {
 	switchDepth       int
 	skipOutputDepth   int
 	importsUseEmitted bool
+	lineDirectives    bool
+	autoescape        *autoescapeState
+	errs              goscanner.ErrorList
+	blockOverrides    map[string]blockOverride
+	includeStack      map[string]bool
+	lineDelta         int // added to p.s.Pos().Line while replaying a {% block %} override
 }
 
-func parse(w io.Writer, r io.Reader, filePath, packageName string) error {
+// parseOption customizes the behavior of parse.
+type parseOption func(*parser)
+
+// withLineDirectives toggles emission of //line directives pointing back
+// into the .qtpl source. It is enabled by default; qtc's -line flag wires
+// up the negative case.
+func withLineDirectives(enable bool) parseOption {
+	return func(p *parser) {
+		p.lineDirectives = enable
+	}
+}
+
+func parse(w io.Writer, r io.Reader, filePath, packageName string, opts ...parseOption) error {
 	p := &parser{
-		s:           newScanner(r, filePath),
-		w:           w,
-		packageName: packageName,
+		s:              newScanner(r, filePath),
+		w:              w,
+		packageName:    packageName,
+		lineDirectives: true,
+		includeStack:   map[string]bool{filePath: true},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 	return p.parseTemplate()
 }
 
 func (p *parser) parseTemplate() error {
 	s := p.s
+	if s.Next() {
+		t := s.Token()
+		if t.ID == tagName && string(t.Value) == "extends" {
+			return p.parseExtends()
+		}
+		s.Rewind()
+	}
 	fmt.Fprintf(p.w, `// This file is automatically generated by qtc from %q.
 // See https://github.com/valyala/quicktemplate for details.
 
@@ -54,37 +85,43 @@ func (p *parser) parseTemplate() error {
 		case tagName:
 			if string(t.Value) == "import" {
 				if p.importsUseEmitted {
-					return fmt.Errorf("imports must be at the top of the template. Found at %s", s.Context())
+					p.errorf("imports must be at the top of the template. Found at %s", s.Context())
+					continue
 				}
 				if err := p.parseImport(); err != nil {
-					return err
+					p.errorf("%s", err)
 				}
 			} else {
 				p.emitImportsUse()
 				switch string(t.Value) {
 				case "interface", "iface":
 					if err := p.parseInterface(); err != nil {
-						return err
+						p.errorf("%s", err)
+						p.synchronize("func")
 					}
 				case "code":
 					if err := p.parseTemplateCode(); err != nil {
-						return err
+						p.errorf("%s", err)
 					}
 				case "func":
 					if err := p.parseFunc(); err != nil {
-						return err
+						p.errorf("%s", err)
+						p.synchronize("func")
 					}
 				default:
-					return fmt.Errorf("unexpected tag found outside func: %q at %s", t.Value, s.Context())
+					p.errorf("unexpected tag found outside func: %q at %s", t.Value, s.Context())
 				}
 			}
 		default:
-			return fmt.Errorf("unexpected token found %s outside func at %s", t, s.Context())
+			p.errorf("unexpected token found %s outside func at %s", t, s.Context())
 		}
 	}
 	p.emitImportsUse()
 	if err := s.LastError(); err != nil {
-		return fmt.Errorf("cannot parse template: %s", err)
+		p.errorf("cannot parse template: %s", err)
+	}
+	if len(p.errs) > 0 {
+		return p.errorList()
 	}
 	return nil
 }
@@ -153,7 +190,9 @@ func (p *parser) parseFunc() error {
 		case tagName:
 			ok, err := p.tryParseCommonTags(t.Value)
 			if err != nil {
-				return fmt.Errorf("error in %q: %s", funcStr, err)
+				p.errorf("error in %q: %s", funcStr, err)
+				p.synchronize("endfunc")
+				continue
 			}
 			if ok {
 				continue
@@ -166,10 +205,11 @@ func (p *parser) parseFunc() error {
 				p.emitFuncEnd(f)
 				return nil
 			default:
-				return fmt.Errorf("unexpected tag found in %q: %q at %s", funcStr, t.Value, s.Context())
+				p.errorf("unexpected tag found in %q: %q at %s", funcStr, t.Value, s.Context())
+				p.synchronize("endfunc")
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", funcStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", funcStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -199,7 +239,9 @@ func (p *parser) parseFor() error {
 		case tagName:
 			ok, err := p.tryParseCommonTags(t.Value)
 			if err != nil {
-				return fmt.Errorf("error in %q: %s", forStr, err)
+				p.errorf("error in %q: %s", forStr, err)
+				p.synchronize("endfor")
+				continue
 			}
 			if ok {
 				continue
@@ -214,10 +256,11 @@ func (p *parser) parseFor() error {
 				p.Printf("}")
 				return nil
 			default:
-				return fmt.Errorf("unexpected tag found in %q: %q at %s", forStr, t.Value, s.Context())
+				p.errorf("unexpected tag found in %q: %q at %s", forStr, t.Value, s.Context())
+				p.synchronize("endfor")
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", forStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", forStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -242,7 +285,9 @@ func (p *parser) parseDefault() error {
 		case tagName:
 			ok, err := p.tryParseCommonTags(t.Value)
 			if err != nil {
-				return fmt.Errorf("error in %q: %s", stmtStr, err)
+				p.errorf("error in %q: %s", stmtStr, err)
+				p.synchronize("endswitch")
+				continue
 			}
 			if !ok {
 				s.Rewind()
@@ -250,7 +295,7 @@ func (p *parser) parseDefault() error {
 				return nil
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -279,7 +324,9 @@ func (p *parser) parseCase() error {
 		case tagName:
 			ok, err := p.tryParseCommonTags(t.Value)
 			if err != nil {
-				return fmt.Errorf("error in %q: %s", caseStr, err)
+				p.errorf("error in %q: %s", caseStr, err)
+				p.synchronize("endswitch")
+				continue
 			}
 			if !ok {
 				s.Rewind()
@@ -287,7 +334,7 @@ func (p *parser) parseCase() error {
 				return nil
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", caseStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", caseStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -326,7 +373,7 @@ func (p *parser) parseSwitch() error {
 			switch string(t.Value) {
 			case "endswitch":
 				if caseNum == 0 {
-					return fmt.Errorf("empty statement %q found at %s", switchStr, s.Context())
+					p.errorf("empty statement %q found at %s", switchStr, s.Context())
 				}
 				if err = skipTagContents(s); err != nil {
 					return err
@@ -337,22 +384,27 @@ func (p *parser) parseSwitch() error {
 			case "case":
 				caseNum++
 				if err = p.parseCase(); err != nil {
-					return err
+					p.errorf("%s", err)
+					p.synchronize("endswitch")
 				}
 			case "default":
 				if defaultFound {
-					return fmt.Errorf("duplicate default tag found in %q at %s", switchStr, s.Context())
+					p.errorf("duplicate default tag found in %q at %s", switchStr, s.Context())
+					p.synchronize("endswitch")
+					break
 				}
 				defaultFound = true
 				caseNum++
 				if err = p.parseDefault(); err != nil {
-					return err
+					p.errorf("%s", err)
+					p.synchronize("endswitch")
 				}
 			default:
-				return fmt.Errorf("unexpected tag found in %q: %q at %s", switchStr, t.Value, s.Context())
+				p.errorf("unexpected tag found in %q: %q at %s", switchStr, t.Value, s.Context())
+				p.synchronize("endswitch")
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", switchStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", switchStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -385,7 +437,9 @@ func (p *parser) parseIf() error {
 		case tagName:
 			ok, err := p.tryParseCommonTags(t.Value)
 			if err != nil {
-				return fmt.Errorf("error in %q: %s", ifStr, err)
+				p.errorf("error in %q: %s", ifStr, err)
+				p.synchronize("endif")
+				continue
 			}
 			if ok {
 				continue
@@ -425,7 +479,7 @@ func (p *parser) parseIf() error {
 				return fmt.Errorf("unexpected tag found in %q: %q at %s", ifStr, t.Value, s.Context())
 			}
 		default:
-			return fmt.Errorf("unexpected token found when parsing %q: %s at %s", ifStr, t, s.Context())
+			p.errorf("unexpected token found when parsing %q: %s at %s", ifStr, t, s.Context())
 		}
 	}
 	if err := s.LastError(); err != nil {
@@ -457,7 +511,13 @@ func (p *parser) tryParseCommonTags(tagBytes []byte) (bool, error) {
 		if strings.HasSuffix(tagNameStr, "=") {
 			tagNameStr = tagNameStr[:len(tagNameStr)-1]
 		}
-		if tagNameStr == "f" && prec >= 0 {
+		if p.autoescape != nil && tagNameStr == "s" {
+			escaper, err := p.autoescape.filterFor(string(t.Value))
+			if err != nil {
+				return false, fmt.Errorf("cannot autoescape at %s: %s", s.Context(), err)
+			}
+			p.Printf("qw%s.%s(%s)", mangleSuffix, escaper, t.Value)
+		} else if tagNameStr == "f" && prec >= 0 {
 			p.Printf("qw%s.N().FPrec(%s, %d)", mangleSuffix, t.Value, prec)
 		} else {
 			tagNameStr = strings.ToUpper(tagNameStr)
@@ -507,6 +567,31 @@ func (p *parser) tryParseCommonTags(tagBytes []byte) (bool, error) {
 		if err := p.parseSwitch(); err != nil {
 			return false, err
 		}
+	case "include":
+		if err := p.parseInclude(); err != nil {
+			return false, err
+		}
+	case "block":
+		if err := p.parseBlock(); err != nil {
+			return false, err
+		}
+	case "autoescape":
+		t, err := expectTagContents(s)
+		if err != nil {
+			return false, err
+		}
+		if mode := strings.TrimSpace(string(t.Value)); mode != "html" {
+			return false, fmt.Errorf("unsupported autoescape mode %q at %s, only %q is supported", mode, s.Context(), "html")
+		}
+		p.autoescape = &autoescapeState{}
+	case "endautoescape":
+		if err := skipTagContents(s); err != nil {
+			return false, err
+		}
+		if p.autoescape == nil {
+			return false, fmt.Errorf("found endautoescape without a matching autoescape tag at %s", s.Context())
+		}
+		p.autoescape = nil
 	default:
 		return false, nil
 	}
@@ -586,7 +671,14 @@ func (p *parser) parseInterface() error {
 	if len(ifname) == 0 {
 		return fmt.Errorf("missing interface name at %s", s.Context())
 	}
-	p.Printf("type %s interface {", ifname)
+	// ifname may carry a generic type parameter list, e.g. "Cache[K comparable, V any]".
+	// Split it off so it can be validated on its own and re-attached verbatim
+	// to the emitted interface declaration.
+	name, typeParams, err := splitTypeParams(ifname)
+	if err != nil {
+		return fmt.Errorf("invalid type parameters in interface %q at %s: %s", ifname, s.Context(), err)
+	}
+	p.Printf("type %s%s interface {", name, typeParams)
 	p.prefix = "\t"
 
 	tail := t.Value[n:]
@@ -659,6 +751,9 @@ func (p *parser) parseFuncCode() error {
 }
 
 func (p *parser) emitText(text []byte) {
+	if p.autoescape != nil {
+		p.autoescape.advance(text)
+	}
 	for len(text) > 0 {
 		n := bytes.IndexByte(text, '`')
 		if n < 0 {
@@ -705,7 +800,14 @@ func (p *parser) Printf(format string, args ...interface{}) {
 	}
 	w := p.w
 	fmt.Fprintf(w, "%s", p.prefix)
-	p.s.WriteLineComment(w)
+	if p.lineDirectives {
+		pos := p.s.Pos()
+		// The prefix written above ends in a line of its own: a //line
+		// directive is only recognized at the start of a line.
+		fmt.Fprintf(w, "\n//line %q:%d\n", pos.Filename, pos.Line+p.lineDelta)
+	} else {
+		p.s.WriteLineComment(w)
+	}
 	fmt.Fprintf(w, "%s", p.prefix)
 	fmt.Fprintf(w, format, args...)
 	fmt.Fprintf(w, "\n")
@@ -731,22 +833,42 @@ func expectToken(s *scanner, id int) (*token, error) {
 	return t, nil
 }
 
+// adjustStmtErrColumn re-expresses a go/parser.ParseExpr error reported
+// against a synthetic "func () { ... }" wrapper (built by prepending
+// prefix to the real tag contents before parsing) so its column points at
+// the actual offset inside the .qtpl tag instead of inside the wrapper.
+func adjustStmtErrColumn(err error, prefixLen int) error {
+	errList, ok := err.(goscanner.ErrorList)
+	if !ok {
+		return err
+	}
+	adjusted := make(goscanner.ErrorList, len(errList))
+	for i, e := range errList {
+		pos := e.Pos
+		pos.Column -= prefixLen
+		if pos.Column < 1 {
+			pos.Column = 1
+		}
+		adjusted[i] = &goscanner.Error{Pos: pos, Msg: e.Msg}
+	}
+	return adjusted
+}
+
 func validateOutputTagValue(stmt []byte) error {
-	exprStr := string(stmt)
-	_, err := goparser.ParseExpr(exprStr)
-	return err
+	_, err := goparser.ParseExpr(string(stmt))
+	return adjustStmtErrColumn(err, 0)
 }
 
 func validateForStmt(stmt []byte) error {
-	exprStr := fmt.Sprintf("func () { for %s {} }", stmt)
-	_, err := goparser.ParseExpr(exprStr)
-	return err
+	const prefix = "func () { for "
+	_, err := goparser.ParseExpr(fmt.Sprintf("%s%s {} }", prefix, stmt))
+	return adjustStmtErrColumn(err, len(prefix))
 }
 
 func validateIfStmt(stmt []byte) error {
-	exprStr := fmt.Sprintf("func () { if %s {} }", stmt)
-	_, err := goparser.ParseExpr(exprStr)
-	return err
+	const prefix = "func () { if "
+	_, err := goparser.ParseExpr(fmt.Sprintf("%s%s {} }", prefix, stmt))
+	return adjustStmtErrColumn(err, len(prefix))
 }
 
 func validateSwitchStmt(stmt []byte) error {
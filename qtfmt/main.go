@@ -0,0 +1,39 @@
+// Command qtfmt formats .qtpl template files, the way gofmt formats .go
+// files. It parses each file into a qtast.File and prints it back out in
+// canonical form: normalized tag spelling, consistent control-flow
+// indentation, trimmed trailing whitespace inside tags, and gofmt'd Go
+// expressions and statements.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/valyala/quicktemplate/qtast"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s file.qtpl [file2.qtpl ...]\n", os.Args[0])
+		os.Exit(1)
+	}
+	for _, filePath := range os.Args[1:] {
+		if err := formatFile(filePath); err != nil {
+			fmt.Fprintf(os.Stderr, "qtfmt: %s\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func formatFile(filePath string) error {
+	src, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %s", filePath, err)
+	}
+	f, err := qtast.Parse(filePath, src)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q: %s", filePath, err)
+	}
+	return f.Fprint(os.Stdout, 0)
+}